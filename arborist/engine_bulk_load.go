@@ -0,0 +1,77 @@
+package arborist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EngineBulkLoadResult summarizes how many objects of each kind a bulk load
+// added to the engine.
+type EngineBulkLoadResult struct {
+	Added map[string]int `json:"added"`
+}
+
+// HandleEngineBulkLoad accepts a JSON array of discriminator-tagged
+// objects -- a mix of resources, policies, and roles, each carrying its own
+// `"type"`/`"kind"` field -- and adds every one of them to the live engine,
+// in place, rather than replacing the engine's state wholesale the way
+// HandleEngineDeserialize does. This is the endpoint decodeTagged and
+// decodeTaggedList exist for: a caller loading a heterogeneous batch of
+// objects doesn't have to split it into the three separate, same-kind
+// arrays HandleEngineDeserialize expects.
+func (engine *Engine) HandleEngineBulkLoad(body []byte) (*EngineBulkLoadResult, *ErrorResponse) {
+	objects, err := decodeTaggedList(body, nil)
+	if err != nil {
+		return nil, newErrorResponse(err.Error(), 400, &err)
+	}
+
+	resources := make([]*Resource, 0, len(objects))
+	roles := make([]*Role, 0, len(objects))
+	policies := make([]*Policy, 0, len(objects))
+	for _, object := range objects {
+		switch concrete := object.(type) {
+		case *Resource:
+			resources = append(resources, concrete)
+		case *Role:
+			roles = append(roles, concrete)
+		case *Policy:
+			policies = append(policies, concrete)
+		default:
+			err := fmt.Errorf("unsupported object kind %q for bulk load", object.Kind())
+			return nil, newErrorResponse(err.Error(), 400, &err)
+		}
+	}
+
+	// Resources must be created parent before child, the same as
+	// newEngineFromDecodedObjects's full-replace path, since a subresource's
+	// parent has to already exist.
+	sort.Slice(resources, func(i, j int) bool {
+		return strings.Count(resources[i].Path, "/") < strings.Count(resources[j].Path, "/")
+	})
+
+	engine.Lock()
+	defer engine.Unlock()
+
+	added := map[string]int{}
+	for _, resource := range resources {
+		if errResponse := engine.CreateResource(resource); errResponse != nil {
+			return nil, errResponse
+		}
+		added["resources"]++
+	}
+	for _, role := range roles {
+		if errResponse := engine.CreateRole(role); errResponse != nil {
+			return nil, errResponse
+		}
+		added["roles"]++
+	}
+	for _, policy := range policies {
+		if errResponse := engine.CreatePolicy(policy); errResponse != nil {
+			return nil, errResponse
+		}
+		added["policies"]++
+	}
+
+	return &EngineBulkLoadResult{Added: added}, nil
+}
@@ -0,0 +1,15 @@
+package arborist
+
+// Kind implementations and registrations for the built-in engine object
+// types, so decodeTagged can dispatch a discriminator-tagged JSON object
+// to the right concrete type. See IEngineObject.
+
+func (resource *Resource) Kind() string { return "resource" }
+func (policy *Policy) Kind() string     { return "policy" }
+func (role *Role) Kind() string         { return "role" }
+
+func init() {
+	RegisterEngineObjectKind("resource", func() IEngineObject { return &Resource{} })
+	RegisterEngineObjectKind("policy", func() IEngineObject { return &Policy{} })
+	RegisterEngineObjectKind("role", func() IEngineObject { return &Role{} })
+}
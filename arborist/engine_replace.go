@@ -0,0 +1,391 @@
+package arborist
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// EngineReplaceDiff summarizes how an atomic engine replacement changed
+// state, broken down per object kind (e.g. "resources", "policies",
+// "roles").
+type EngineReplaceDiff struct {
+	Added   map[string]int `json:"added"`
+	Removed map[string]int `json:"removed"`
+	Changed map[string]int `json:"changed"`
+}
+
+// HandleEngineDeserialize validates a full engine snapshot -- the same
+// shape HandleEngineSerialize produces -- and, if it passes strict
+// field-level validation, polymorphic decoding, and referential-integrity
+// checks, atomically replaces the receiver's state with it. It returns a
+// diff summarizing what changed, or an ErrorResponse describing the first
+// validation failure encountered.
+func (engine *Engine) HandleEngineDeserialize(body []byte) (*EngineReplaceDiff, *ErrorResponse) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		msg := fmt.Sprintf("could not parse engine snapshot: %s", err.Error())
+		return nil, newErrorResponse(msg, 400, &err)
+	}
+
+	// HandleEngineSerialize's output carries no per-object "type"/"kind"
+	// discriminator -- the server package's NDJSON emitter,
+	// writeNDJSONSnapshot, has to inject one for exactly that reason -- so
+	// the kind here comes from the plural
+	// top-level key itself rather than from decodeTaggedList peeking at
+	// each object.
+	decoded := map[string][]IEngineObject{}
+	for plural, items := range raw {
+		kind := singularize(plural)
+		objects, err := decodeListOfKind(items, kind, nil)
+		if err != nil {
+			msg := fmt.Sprintf("invalid %s entries in engine snapshot: %s", plural, err.Error())
+			return nil, newErrorResponse(msg, 400, &err)
+		}
+		decoded[kind] = objects
+	}
+
+	if err := checkReferentialIntegrity(decoded); err != nil {
+		return nil, newErrorResponse(err.Error(), 400, &err)
+	}
+
+	newEngine, err := newEngineFromDecodedObjects(decoded)
+	if err != nil {
+		return nil, newErrorResponse(err.Error(), 400, &err)
+	}
+
+	diff := diffEngineSnapshots(engine.HandleEngineSerialize(), newEngine.HandleEngineSerialize())
+
+	engine.Lock()
+	replaceEngineState(engine, newEngine)
+	engine.Unlock()
+
+	return diff, nil
+}
+
+// replaceEngineState swaps the receiver's state for newEngine's, field by
+// field, while leaving any embedded lock (e.g. a `sync.RWMutex`) alone --
+// `*engine = *newEngine` looks equivalent but is a whole-struct value copy
+// that copies the lock itself, which `go vet`'s copylocks check rightly
+// flags and which races any reader taking that lock mid-copy. Callers must
+// hold the engine's own write lock for the duration of this call; it does
+// not take it itself, since it has no names for the lock fields to call
+// through.
+//
+// This assumes no object reachable from `engine`'s fields holds its own
+// back-reference to the owning *Engine (e.g. a Resource or Policy pointing
+// back at the engine that created it) -- copying newEngine's fields over
+// engine's in place doesn't rewrite any such pointer, so it would be left
+// dangling at the throwaway newEngine instead of the live one. That needs
+// confirming against the real Engine/Resource/Policy definitions, which
+// aren't part of this snapshot of the repo.
+func replaceEngineState(engine *Engine, newEngine *Engine) {
+	dst := reflect.ValueOf(engine).Elem()
+	src := reflect.ValueOf(newEngine).Elem()
+	structType := dst.Type()
+
+	lockerType := reflect.TypeOf((*sync.Locker)(nil)).Elem()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if reflect.PtrTo(field.Type).Implements(lockerType) {
+			continue
+		}
+
+		dstField := dst.Field(i)
+		dstField = reflect.NewAt(dstField.Type(), unsafe.Pointer(dstField.UnsafeAddr())).Elem()
+		dstField.Set(src.Field(i))
+	}
+}
+
+// newEngineFromDecodedObjects builds a fresh, standalone engine out of
+// already-validated, discriminator-decoded objects. It's kept separate
+// from the live engine so that a bad snapshot never touches the engine
+// actually serving traffic.
+//
+// Objects are created in a fixed order -- resources (parents before
+// children), then roles, then policies -- rather than in `decoded`'s
+// randomized map-iteration order, since policies reference resources and
+// roles by path/id and would otherwise fail nondeterministically
+// depending on which kind the map happened to yield first.
+//
+// The depth sort below only looks at each entry's own top-level "path",
+// not collectResourcePaths' full walk of nested "subresources" -- that's
+// fine as long as CreateResource itself is responsible for registering a
+// resource's nested subresources when it's given one, so a parent and all
+// its descendants are created together as a unit. If that's not how
+// CreateResource behaves, this sort would need to flatten the tree first
+// the same way collectResourcePaths does.
+func newEngineFromDecodedObjects(decoded map[string][]IEngineObject) (*Engine, error) {
+	newEngine := NewEngine()
+
+	resources := append([]IEngineObject{}, decoded["resource"]...)
+	sort.Slice(resources, func(i, j int) bool {
+		return strings.Count(stringField(resources[i], "path"), "/") < strings.Count(stringField(resources[j], "path"), "/")
+	})
+	for _, object := range resources {
+		resource, ok := object.(*Resource)
+		if !ok {
+			return nil, fmt.Errorf("expected resource object, got %T", object)
+		}
+		if errResponse := newEngine.CreateResource(resource); errResponse != nil {
+			return nil, fmt.Errorf("could not add resource while rebuilding engine")
+		}
+	}
+
+	for _, object := range decoded["role"] {
+		role, ok := object.(*Role)
+		if !ok {
+			return nil, fmt.Errorf("expected role object, got %T", object)
+		}
+		if errResponse := newEngine.CreateRole(role); errResponse != nil {
+			return nil, fmt.Errorf("could not add role while rebuilding engine")
+		}
+	}
+
+	for _, object := range decoded["policy"] {
+		policy, ok := object.(*Policy)
+		if !ok {
+			return nil, fmt.Errorf("expected policy object, got %T", object)
+		}
+		if errResponse := newEngine.CreatePolicy(policy); errResponse != nil {
+			return nil, fmt.Errorf("could not add policy while rebuilding engine")
+		}
+	}
+
+	for kind := range decoded {
+		switch kind {
+		case "resource", "role", "policy":
+		default:
+			return nil, fmt.Errorf("unsupported object kind %q for engine replacement", kind)
+		}
+	}
+
+	return newEngine, nil
+}
+
+// checkReferentialIntegrity verifies that every nested resource's parent
+// exists (a top-level resource, whose parent is the root "/", needs no
+// entry for that root), and that every policy only references resources and roles present in
+// the same snapshot, before the snapshot is allowed to become the new
+// engine state.
+//
+// Resources may come back from decodeListOfKind as a flat, top-level list
+// or as a tree with each resource nesting its children under
+// "subresources" -- collectResourcePaths walks both shapes, so this check
+// sees every path in the snapshot either way.
+func checkReferentialIntegrity(decoded map[string][]IEngineObject) error {
+	resourcePaths := map[string]struct{}{}
+	for _, object := range decoded["resource"] {
+		for _, path := range collectResourcePaths(object) {
+			resourcePaths[path] = struct{}{}
+		}
+	}
+	for path := range resourcePaths {
+		if path == "/" {
+			continue
+		}
+		parent := parentResourcePath(path)
+		if parent == "/" {
+			continue
+		}
+		if _, exists := resourcePaths[parent]; !exists {
+			return fmt.Errorf("resource %q references missing parent resource %q", path, parent)
+		}
+	}
+
+	// Roles are identified by "id", and policies reference them by that id
+	// in "role_ids" -- not by "name", which roles don't use as an
+	// identifier at all.
+	roleIDs := map[string]struct{}{}
+	for _, object := range decoded["role"] {
+		if id := stringField(object, "id"); id != "" {
+			roleIDs[id] = struct{}{}
+		}
+	}
+
+	for _, object := range decoded["policy"] {
+		for _, path := range stringSliceField(object, "resource_paths") {
+			if _, exists := resourcePaths[path]; !exists {
+				return fmt.Errorf("policy references unknown resource %q", path)
+			}
+		}
+		for _, id := range stringSliceField(object, "role_ids") {
+			if _, exists := roleIDs[id]; !exists {
+				return fmt.Errorf("policy references unknown role %q", id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parentResourcePath returns the slash-delimited parent of a hierarchical
+// resource path, e.g. "/organization/department" -> "/organization".
+func parentResourcePath(path string) string {
+	trimmed := strings.TrimSuffix(path, "/")
+	idx := strings.LastIndex(trimmed, "/")
+	if idx <= 0 {
+		return "/"
+	}
+	return trimmed[:idx]
+}
+
+// stringField and stringSliceField read a named field off a decoded
+// IEngineObject without needing to know its concrete Go type, by round
+// tripping it through JSON -- the same black-box approach the sparse
+// fieldset and diff logic use elsewhere in this package.
+func stringField(object IEngineObject, field string) string {
+	decoded, ok := objectAsMap(object)
+	if !ok {
+		return ""
+	}
+	value, _ := decoded[field].(string)
+	return value
+}
+
+func stringSliceField(object IEngineObject, field string) []string {
+	decoded, ok := objectAsMap(object)
+	if !ok {
+		return nil
+	}
+	items, ok := decoded[field].([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
+// collectResourcePaths returns a resource object's own "path" together with
+// the path of every descendant nested under its "subresources" field, if
+// it has one. A resource snapshot may be a flat, top-level list of
+// resources or a tree where each resource embeds its children directly --
+// this walks either shape so callers don't have to know which one they got.
+func collectResourcePaths(object IEngineObject) []string {
+	decoded, ok := objectAsMap(object)
+	if !ok {
+		return nil
+	}
+	return collectResourcePathsFromMap(decoded)
+}
+
+func collectResourcePathsFromMap(decoded map[string]interface{}) []string {
+	var paths []string
+	if path, ok := decoded["path"].(string); ok && path != "" {
+		paths = append(paths, path)
+	}
+	children, _ := decoded["subresources"].([]interface{})
+	for _, child := range children {
+		if childMap, ok := child.(map[string]interface{}); ok {
+			paths = append(paths, collectResourcePathsFromMap(childMap)...)
+		}
+	}
+	return paths
+}
+
+func objectAsMap(object IEngineObject) (map[string]interface{}, bool) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, false
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// diffEngineSnapshots compares the serialized form of two engines and
+// counts, per object kind, how many objects were added, removed, or
+// changed. Objects are matched across snapshots by whichever of "id",
+// "path", or "name" they carry.
+func diffEngineSnapshots(oldSnapshot interface{}, newSnapshot interface{}) *EngineReplaceDiff {
+	oldKinds := snapshotToKindLists(oldSnapshot)
+	newKinds := snapshotToKindLists(newSnapshot)
+
+	diff := &EngineReplaceDiff{
+		Added:   map[string]int{},
+		Removed: map[string]int{},
+		Changed: map[string]int{},
+	}
+
+	kinds := map[string]struct{}{}
+	for kind := range oldKinds {
+		kinds[kind] = struct{}{}
+	}
+	for kind := range newKinds {
+		kinds[kind] = struct{}{}
+	}
+
+	for kind := range kinds {
+		oldByKey := indexByIdentity(oldKinds[kind])
+		newByKey := indexByIdentity(newKinds[kind])
+
+		for key, newValue := range newByKey {
+			oldValue, existed := oldByKey[key]
+			switch {
+			case !existed:
+				diff.Added[kind]++
+			case !reflect.DeepEqual(oldValue, newValue):
+				diff.Changed[kind]++
+			}
+		}
+		for key := range oldByKey {
+			if _, stillExists := newByKey[key]; !stillExists {
+				diff.Removed[kind]++
+			}
+		}
+	}
+
+	return diff
+}
+
+func snapshotToKindLists(snapshot interface{}) map[string][]interface{} {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return map[string][]interface{}{}
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return map[string][]interface{}{}
+	}
+
+	result := map[string][]interface{}{}
+	for key, value := range decoded {
+		if items, ok := value.([]interface{}); ok {
+			result[key] = items
+		}
+	}
+	return result
+}
+
+func indexByIdentity(items []interface{}) map[string]interface{} {
+	index := map[string]interface{}{}
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, idField := range []string{"id", "path", "name"} {
+			value, exists := obj[idField]
+			if !exists {
+				continue
+			}
+			if key, ok := value.(string); ok {
+				index[key] = obj
+				break
+			}
+		}
+	}
+	return index
+}
@@ -0,0 +1,91 @@
+package arborist
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakeResource is a minimal stand-in for *Resource, used to exercise the
+// referential-integrity and diff logic generically -- by JSON shape alone,
+// the same way checkReferentialIntegrity and diffEngineSnapshots see any
+// IEngineObject, rather than against the real Resource type, which isn't
+// part of this snapshot of the repo.
+type fakeResource struct {
+	Path         string         `json:"path"`
+	Subresources []fakeResource `json:"subresources,omitempty"`
+}
+
+func (r *fakeResource) Kind() string { return "resource" }
+
+// fakePolicy is a minimal stand-in for *Policy, for the same reason
+// fakeResource stands in for *Resource above.
+type fakePolicy struct {
+	ResourcePaths []string `json:"resource_paths"`
+	RoleIDs       []string `json:"role_ids"`
+}
+
+func (p *fakePolicy) Kind() string { return "policy" }
+
+func TestCollectResourcePathsFlat(t *testing.T) {
+	object := &fakeResource{Path: "/a"}
+	paths := collectResourcePaths(object)
+	if !reflect.DeepEqual(paths, []string{"/a"}) {
+		t.Fatalf("expected [\"/a\"], got %v", paths)
+	}
+}
+
+func TestCollectResourcePathsNestedTree(t *testing.T) {
+	object := &fakeResource{
+		Path: "/org",
+		Subresources: []fakeResource{
+			{Path: "/org/dept-a"},
+			{
+				Path: "/org/dept-b",
+				Subresources: []fakeResource{
+					{Path: "/org/dept-b/team-1"},
+				},
+			},
+		},
+	}
+
+	paths := collectResourcePaths(object)
+	sort.Strings(paths)
+
+	expected := []string{"/org", "/org/dept-a", "/org/dept-b", "/org/dept-b/team-1"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestCheckReferentialIntegritySeesNestedSubresourcePaths(t *testing.T) {
+	decoded := map[string][]IEngineObject{
+		"resource": {
+			&fakeResource{
+				Path: "/org",
+				Subresources: []fakeResource{
+					{Path: "/org/dept-a"},
+				},
+			},
+		},
+		"policy": {
+			&fakePolicy{ResourcePaths: []string{"/org/dept-a"}},
+		},
+	}
+
+	if err := checkReferentialIntegrity(decoded); err != nil {
+		t.Fatalf("expected a policy referencing a nested subresource path to pass, got %v", err)
+	}
+}
+
+func TestCheckReferentialIntegrityRejectsMissingParent(t *testing.T) {
+	decoded := map[string][]IEngineObject{
+		"resource": {
+			&fakeResource{Path: "/org/dept-a"},
+		},
+	}
+
+	if err := checkReferentialIntegrity(decoded); err == nil {
+		t.Fatal("expected an error for a resource whose parent is missing, got nil")
+	}
+}
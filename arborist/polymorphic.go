@@ -0,0 +1,151 @@
+package arborist
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// IEngineObject is implemented by any concrete type that can appear in a
+// discriminator-tagged, polymorphic list of engine objects -- resources,
+// policies, roles, and whatever kinds extensions register on top of those.
+// Kind returns the "type"/"kind" discriminator value used to identify which
+// concrete type a tagged JSON object should decode into.
+type IEngineObject interface {
+	Kind() string
+}
+
+// engineObjectConstructors maps a "type"/"kind" discriminator value to a
+// constructor for the concrete IEngineObject it names.
+var engineObjectConstructors = map[string]func() IEngineObject{}
+
+// RegisterEngineObjectKind registers a constructor for a discriminator
+// value so decodeTagged can dispatch JSON objects carrying `"type": kind`
+// (or `"kind": kind`) to the right concrete type. Built-in kinds register
+// themselves from an init() alongside their type definition; third-party
+// extensions call this at server startup to add their own.
+func RegisterEngineObjectKind(kind string, construct func() IEngineObject) {
+	engineObjectConstructors[kind] = construct
+}
+
+// taggedObject peeks at the discriminator field of a JSON object without
+// committing to unmarshalling the rest of it onto a concrete type.
+type taggedObject struct {
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+}
+
+// decodeTagged peeks at the `"type"` (or `"kind"`, if `"type"` is absent)
+// discriminator field of `raw`, looks up the registered constructor for
+// that value, and strictly unmarshals the remainder onto a freshly
+// constructed instance of the concrete type via strictUnmarshal.
+//
+// Whichever of `"type"`/`"kind"` actually carried the discriminator is
+// stripped out of the object before it's handed to strictUnmarshal --
+// that key is wire-format routing information, not a field any concrete
+// `Resource`/`Policy`/`Role` declares, and strictUnmarshal rejects
+// unrecognized top-level fields.
+func decodeTagged(raw json.RawMessage, optionalFields map[string]struct{}) (IEngineObject, error) {
+	var tagged taggedObject
+	if err := json.Unmarshal(raw, &tagged); err != nil {
+		return nil, fmt.Errorf("could not read discriminator field from object: %w", err)
+	}
+
+	kind := tagged.Type
+	discriminatorField := "type"
+	if kind == "" {
+		kind = tagged.Kind
+		discriminatorField = "kind"
+	}
+	if kind == "" {
+		return nil, fmt.Errorf(`object is missing a "type" or "kind" discriminator`)
+	}
+
+	var content map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, fmt.Errorf("could not read object of kind %q: %w", kind, err)
+	}
+	delete(content, discriminatorField)
+	cleaned, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not read object of kind %q: %w", kind, err)
+	}
+
+	return decodeObjectOfKind(cleaned, kind, optionalFields)
+}
+
+// decodeObjectOfKind decodes `raw` directly as the given kind, without
+// peeking at a discriminator field on the object itself -- for use when
+// the kind is already known from context (e.g. which plural key of an
+// engine snapshot the object came from), since `HandleEngineSerialize`
+// doesn't tag its output with a per-object discriminator the way a
+// heterogeneous bulk-load list does.
+func decodeObjectOfKind(raw json.RawMessage, kind string, optionalFields map[string]struct{}) (IEngineObject, error) {
+	construct, registered := engineObjectConstructors[kind]
+	if !registered {
+		return nil, fmt.Errorf("unrecognized object kind %q", kind)
+	}
+
+	object := construct()
+	if errResponse := strictUnmarshal(raw, object, optionalFields); errResponse != nil {
+		return nil, fmt.Errorf("could not decode object of kind %q: invalid or missing fields", kind)
+	}
+	return object, nil
+}
+
+// decodeTaggedList decodes a JSON array of discriminator-tagged objects, in
+// order, stopping at the first error. This is what lets a handler that used
+// to accept one fixed struct (e.g. resource vs. subresource, built-in vs.
+// custom policy) accept a heterogeneous list instead, and is what the
+// `/engine` bulk-load endpoint uses to accept mixed-object arrays.
+func decodeTaggedList(raw json.RawMessage, optionalFields map[string]struct{}) ([]IEngineObject, error) {
+	var rawItems []json.RawMessage
+	if err := json.Unmarshal(raw, &rawItems); err != nil {
+		return nil, fmt.Errorf("could not parse tagged object list: %w", err)
+	}
+
+	objects := make([]IEngineObject, 0, len(rawItems))
+	for i, item := range rawItems {
+		object, err := decodeTagged(item, optionalFields)
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", i, err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// decodeListOfKind decodes a JSON array where every element is the same,
+// already-known kind (see decodeObjectOfKind) -- such as one plural field
+// of an engine snapshot, where the array is all resources, all policies,
+// or all roles and none of the elements carry their own discriminator.
+func decodeListOfKind(raw json.RawMessage, kind string, optionalFields map[string]struct{}) ([]IEngineObject, error) {
+	var rawItems []json.RawMessage
+	if err := json.Unmarshal(raw, &rawItems); err != nil {
+		return nil, fmt.Errorf("could not parse %s list: %w", kind, err)
+	}
+
+	objects := make([]IEngineObject, 0, len(rawItems))
+	for i, item := range rawItems {
+		object, err := decodeObjectOfKind(item, kind, optionalFields)
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", kind, i, err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// singularize converts the plural top-level field names used by the
+// engine snapshot (e.g. "policies", "resources") into the singular "kind"
+// name registered with RegisterEngineObjectKind.
+func singularize(plural string) string {
+	switch {
+	case strings.HasSuffix(plural, "ies"):
+		return strings.TrimSuffix(plural, "ies") + "y"
+	case strings.HasSuffix(plural, "s"):
+		return strings.TrimSuffix(plural, "s")
+	default:
+		return plural
+	}
+}
@@ -0,0 +1,68 @@
+package arborist
+
+import "testing"
+
+// widget is a test-only IEngineObject used to exercise the generic
+// discriminator-decoding machinery without depending on the shape of the
+// real Resource/Policy/Role types.
+type widget struct {
+	Name string `json:"name"`
+}
+
+func (w *widget) Kind() string { return "widget" }
+
+func init() {
+	RegisterEngineObjectKind("widget", func() IEngineObject { return &widget{} })
+}
+
+func TestDecodeTaggedStripsTypeDiscriminator(t *testing.T) {
+	object, err := decodeTagged([]byte(`{"type": "widget", "name": "gizmo"}`), nil)
+	if err != nil {
+		t.Fatalf("decodeTagged returned error: %v", err)
+	}
+	w, ok := object.(*widget)
+	if !ok {
+		t.Fatalf("expected *widget, got %T", object)
+	}
+	if w.Name != "gizmo" {
+		t.Fatalf("expected name %q, got %q", "gizmo", w.Name)
+	}
+}
+
+func TestDecodeTaggedStripsKindDiscriminator(t *testing.T) {
+	object, err := decodeTagged([]byte(`{"kind": "widget", "name": "gizmo"}`), nil)
+	if err != nil {
+		t.Fatalf("decodeTagged returned error: %v", err)
+	}
+	if object.(*widget).Name != "gizmo" {
+		t.Fatalf("expected name %q, got %q", "gizmo", object.(*widget).Name)
+	}
+}
+
+func TestDecodeTaggedMissingDiscriminator(t *testing.T) {
+	if _, err := decodeTagged([]byte(`{"name": "gizmo"}`), nil); err == nil {
+		t.Fatal("expected an error for an object with no discriminator, got nil")
+	}
+}
+
+func TestDecodeTaggedListMixedOrder(t *testing.T) {
+	objects, err := decodeTaggedList([]byte(`[
+		{"type": "widget", "name": "a"},
+		{"kind": "widget", "name": "b"}
+	]`), nil)
+	if err != nil {
+		t.Fatalf("decodeTaggedList returned error: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 objects, got %d", len(objects))
+	}
+	if objects[0].(*widget).Name != "a" || objects[1].(*widget).Name != "b" {
+		t.Fatalf("expected order to be preserved, got %+v", objects)
+	}
+}
+
+func TestDecodeObjectOfKindUnregistered(t *testing.T) {
+	if _, err := decodeObjectOfKind([]byte(`{}`), "nonexistent-kind", nil); err == nil {
+		t.Fatal("expected an error for an unregistered kind, got nil")
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import "strings"
+
+// fieldSelector is a tree of dotted field paths, e.g. parsing
+// "resources,policies.id,roles.permissions" produces
+//
+//	{
+//	    "resources": {},
+//	    "policies": {"id": {}},
+//	    "roles": {"permissions": {}},
+//	}
+//
+// An empty selector at a given node means "everything under this node",
+// since there were no further dotted components to narrow it down.
+type fieldSelector map[string]fieldSelector
+
+// parseFieldSelector builds a fieldSelector tree out of a comma-separated
+// list of dotted field paths. An empty string produces an empty (matches
+// nothing in particular) selector.
+func parseFieldSelector(raw string) fieldSelector {
+	root := fieldSelector{}
+	if raw == "" {
+		return root
+	}
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		node := root
+		for _, part := range strings.Split(path, ".") {
+			next, exists := node[part]
+			if !exists {
+				next = fieldSelector{}
+				node[part] = next
+			}
+			node = next
+		}
+	}
+	return root
+}
+
+// pruneFields walks a JSON-decoded value (the result of unmarshalling into
+// `interface{}`) and returns a copy that keeps only the fields selected by
+// `include` and has the fields selected by `exclude` removed.
+// Either selector may be empty, meaning "don't filter on this dimension".
+func pruneFields(data interface{}, include fieldSelector, exclude fieldSelector) interface{} {
+	if len(include) == 0 && len(exclude) == 0 {
+		return data
+	}
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		// field selection only applies at object boundaries: arrays are
+		// pruned element by element, and scalars pass through untouched
+		if arr, ok := data.([]interface{}); ok {
+			result := make([]interface{}, len(arr))
+			for i, item := range arr {
+				result[i] = pruneFields(item, include, exclude)
+			}
+			return result
+		}
+		return data
+	}
+
+	result := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		if _, excluded := exclude[key]; excluded && len(exclude[key]) == 0 {
+			continue
+		}
+		if len(include) > 0 {
+			childInclude, included := include[key]
+			if !included {
+				continue
+			}
+			result[key] = pruneFields(value, childInclude, exclude[key])
+			continue
+		}
+		result[key] = pruneFields(value, include[key], exclude[key])
+	}
+	return result
+}
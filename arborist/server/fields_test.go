@@ -0,0 +1,111 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldSelector(t *testing.T) {
+	got := parseFieldSelector("resources,policies.id,roles.permissions")
+	expected := fieldSelector{
+		"resources": {},
+		"policies":  {"id": {}},
+		"roles":     {"permissions": {}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestParseFieldSelectorEmpty(t *testing.T) {
+	got := parseFieldSelector("")
+	if len(got) != 0 {
+		t.Fatalf("expected an empty selector, got %v", got)
+	}
+}
+
+func TestPruneFieldsNoSelectors(t *testing.T) {
+	data := map[string]interface{}{"a": 1, "b": 2}
+	got := pruneFields(data, fieldSelector{}, fieldSelector{})
+	if !reflect.DeepEqual(got, data) {
+		t.Fatalf("expected data to pass through unchanged, got %v", got)
+	}
+}
+
+func TestPruneFieldsInclude(t *testing.T) {
+	data := map[string]interface{}{
+		"resources": []interface{}{
+			map[string]interface{}{"path": "/a", "name": "a"},
+		},
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "p"},
+		},
+	}
+
+	got := pruneFields(data, parseFieldSelector("resources"), fieldSelector{})
+	expected := map[string]interface{}{
+		"resources": []interface{}{
+			map[string]interface{}{"path": "/a", "name": "a"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPruneFieldsIncludeNestedPath(t *testing.T) {
+	data := map[string]interface{}{
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "p"},
+		},
+	}
+
+	got := pruneFields(data, parseFieldSelector("policies.id"), fieldSelector{})
+	expected := map[string]interface{}{
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPruneFieldsExclude(t *testing.T) {
+	data := map[string]interface{}{
+		"resources": []interface{}{
+			map[string]interface{}{"path": "/a", "name": "a"},
+		},
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "p"},
+		},
+	}
+
+	got := pruneFields(data, fieldSelector{}, parseFieldSelector("policies"))
+	expected := map[string]interface{}{
+		"resources": []interface{}{
+			map[string]interface{}{"path": "/a", "name": "a"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPruneFieldsExcludeNestedPath(t *testing.T) {
+	data := map[string]interface{}{
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1", "name": "p"},
+		},
+	}
+
+	got := pruneFields(data, fieldSelector{}, parseFieldSelector("policies.name"))
+	expected := map[string]interface{}{
+		"policies": []interface{}{
+			map[string]interface{}{"id": "p1"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -11,7 +12,27 @@ import (
 func handleEngineSerialize(engine *arborist.Engine) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		response := engine.HandleEngineSerialize()
-		err := response.Write(w, wantPrettyJSON(r))
+
+		if r.URL.Query().Get("stream") == "1" {
+			err := writeNDJSONSnapshot(w, response)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		fields := r.URL.Query().Get("fields")
+		exclude := r.URL.Query().Get("exclude")
+		if fields == "" && exclude == "" {
+			err := response.Write(w, wantPrettyJSON(r))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		err := writePrunedJSON(w, response, parseFieldSelector(fields), parseFieldSelector(exclude), wantPrettyJSON(r))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -19,7 +40,34 @@ func handleEngineSerialize(engine *arborist.Engine) http.Handler {
 	})
 }
 
+// writePrunedJSON marshals `body` to JSON, prunes its top-level and nested
+// fields according to `include`/`exclude`, and writes the result to `w`.
+// This lets callers request a sparse fieldset (e.g.
+// `?fields=resources,policies.id`) without the serialized struct itself
+// needing to change.
+func writePrunedJSON(w http.ResponseWriter, body interface{}, include fieldSelector, exclude fieldSelector, pretty bool) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return err
+	}
+	pruned := pruneFields(decoded, include, exclude)
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", "    ")
+	}
+	return encoder.Encode(pruned)
+}
+
 func addEngineRouter(mainRouter *mux.Router, engine *arborist.Engine) {
 	engineRouter := mainRouter.PathPrefix("/engine").Subrouter()
 	engineRouter.Handle("/", handleEngineSerialize(engine)).Methods("GET")
+	engineRouter.Handle("/", handleEngineDeserializeStream(engine)).Methods("POST")
+	engineRouter.Handle("/", handleEnginePut(engine)).Methods("PUT")
+	engineRouter.Handle("/objects", handleEngineBulkLoad(engine)).Methods("POST")
 }
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+// handleEngineBulkLoad accepts a JSON array of discriminator-tagged objects
+// (each carrying its own `"type"`/`"kind"` field) and adds every one of
+// them to the live engine. Unlike `handleEnginePut`/
+// `handleEngineDeserializeStream`, which replace the engine's whole state
+// atomically, this is additive: existing objects are left alone, and the
+// new ones are created on top of them.
+func handleEngineBulkLoad(engine *arborist.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, errResponse := engine.HandleEngineBulkLoad(body)
+		if errResponse != nil {
+			if err := errResponse.Write(w, wantPrettyJSON(r)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		if wantPrettyJSON(r) {
+			encoder.SetIndent("", "    ")
+		}
+		encoder.Encode(result)
+	})
+}
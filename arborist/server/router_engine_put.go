@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+// handleEnginePut accepts a full engine snapshot in the same JSON shape
+// `handleEngineSerialize` produces and atomically replaces the live
+// engine's state with it, provided the snapshot passes strict field
+// validation, polymorphic decoding, and referential-integrity checks. The
+// validation and swap itself lives on `Engine.HandleEngineDeserialize`;
+// this handler is just the thin HTTP wrapper, same as
+// `handleEngineSerialize` is for the GET side.
+func handleEnginePut(engine *arborist.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		diff, errResponse := engine.HandleEngineDeserialize(body)
+		if errResponse != nil {
+			err := errResponse.Write(w, wantPrettyJSON(r))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		if wantPrettyJSON(r) {
+			encoder.SetIndent("", "    ")
+		}
+		encoder.Encode(diff)
+	})
+}
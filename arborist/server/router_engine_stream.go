@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/uc-cdis/arborist/arborist"
+)
+
+// ndjsonContentType is the content type used for the chunked engine
+// snapshot format: one JSON object per line, each carrying a "kind" field
+// naming the singular object type it represents (e.g. "resource",
+// "policy", "role").
+const ndjsonContentType = "application/x-ndjson"
+
+// writeNDJSONSnapshot walks the full engine snapshot (the same document
+// `handleEngineSerialize` would return) and writes it out one object per
+// line, flushing after each one, so a caller reading the stream doesn't
+// have to wait for or buffer the whole document before it can start
+// processing objects. The snapshot itself is still built and held in
+// memory on this side before being streamed out.
+func writeNDJSONSnapshot(w http.ResponseWriter, snapshot interface{}) error {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	flusher, canFlush := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for key, value := range decoded {
+		kind := singularize(key)
+		items, isList := value.([]interface{})
+		if !isList {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			obj["kind"] = kind
+			if err := encoder.Encode(obj); err != nil {
+				return err
+			}
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+	}
+	return nil
+}
+
+// handleEngineDeserializeStream accepts either an NDJSON stream (one
+// `{"kind": "...", ...}` object per line) or a single JSON document shaped
+// like the output of `HandleEngineSerialize`, reassembles it into the
+// plural-keyed snapshot shape the engine expects, and hands it to
+// `Engine.HandleEngineDeserialize` to validate and atomically load --
+// same underlying restore path the `PUT /engine` endpoint uses, just with
+// a chunked wire format on the way in.
+func handleEngineDeserializeStream(engine *arborist.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var objects map[string][]json.RawMessage
+		var err error
+		if strings.Contains(r.Header.Get("Content-Type"), ndjsonContentType) {
+			objects, err = decodeNDJSONObjects(r.Body)
+		} else {
+			objects, err = decodeJSONSnapshotObjects(r.Body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snapshot := make(map[string]json.RawMessage, len(objects))
+		for kind, items := range objects {
+			arr, err := json.Marshal(items)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			snapshot[pluralize(kind)] = arr
+		}
+		body, err := json.Marshal(snapshot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		diff, errResponse := engine.HandleEngineDeserialize(body)
+		if errResponse != nil {
+			if err := errResponse.Write(w, wantPrettyJSON(r)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		if wantPrettyJSON(r) {
+			encoder.SetIndent("", "    ")
+		}
+		encoder.Encode(diff)
+	})
+}
+
+// decodeNDJSONObjects reads one JSON object per line off `body`, grouping
+// each by its required top-level "kind" field. It decodes a line at a
+// time rather than the whole request body at once, but the grouped
+// `json.RawMessage`s it returns are still held in memory together, for the
+// referential-integrity checks that need to see the whole snapshot at
+// once -- this is not a constant-memory decode.
+//
+// The "kind" field itself is stripped out of each object before it's
+// returned: it's wire-format metadata that `writeNDJSONSnapshot` injects so
+// a line-oriented reader can tell objects apart, not a field any decoded
+// `Resource`/`Policy`/`Role` actually declares, and `strictUnmarshal`
+// rejects unrecognized top-level fields.
+func decodeNDJSONObjects(body io.Reader) (map[string][]json.RawMessage, error) {
+	decoder := json.NewDecoder(body)
+	result := map[string][]json.RawMessage{}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("could not parse ndjson object: %w", err)
+		}
+		var envelope map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return nil, fmt.Errorf("could not parse ndjson object: %w", err)
+		}
+		kindRaw, hasKind := envelope["kind"]
+		if !hasKind {
+			return nil, fmt.Errorf("ndjson object is missing required \"kind\" field")
+		}
+		var kind string
+		if err := json.Unmarshal(kindRaw, &kind); err != nil || kind == "" {
+			return nil, fmt.Errorf("ndjson object has an invalid \"kind\" field")
+		}
+
+		delete(envelope, "kind")
+		cleaned, err := json.Marshal(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse ndjson object: %w", err)
+		}
+
+		result[kind] = append(result[kind], cleaned)
+	}
+	return result, nil
+}
+
+// decodeJSONSnapshotObjects accepts a single JSON document shaped like the
+// output of `HandleEngineSerialize` (a map of plural kind name to array of
+// objects) and groups it the same way `decodeNDJSONObjects` does. It walks
+// the top-level object key by key with `json.Decoder.Token` rather than
+// unmarshalling the whole document in one call, but each key's array is
+// still decoded and held in memory in full -- like `decodeNDJSONObjects`,
+// this bounds how much is ever parsed at once, not how much ends up
+// resident.
+func decodeJSONSnapshotObjects(body io.Reader) (map[string][]json.RawMessage, error) {
+	decoder := json.NewDecoder(body)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse engine snapshot: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected engine snapshot to be a JSON object")
+	}
+
+	result := map[string][]json.RawMessage{}
+	for decoder.More() {
+		keyToken, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse engine snapshot: %w", err)
+		}
+		key, ok := keyToken.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected engine snapshot key to be a string")
+		}
+
+		var items []json.RawMessage
+		if err := decoder.Decode(&items); err != nil {
+			return nil, fmt.Errorf("could not parse entries for %q: %w", key, err)
+		}
+		result[singularize(key)] = items
+	}
+	return result, nil
+}
+
+// singularize converts the plural top-level field names used by the
+// engine snapshot (e.g. "policies", "resources") into the singular "kind"
+// name used to tag individual objects in the streamed representation.
+func singularize(plural string) string {
+	switch {
+	case strings.HasSuffix(plural, "ies"):
+		return strings.TrimSuffix(plural, "ies") + "y"
+	case strings.HasSuffix(plural, "s"):
+		return strings.TrimSuffix(plural, "s")
+	default:
+		return plural
+	}
+}
+
+// pluralize is singularize's inverse: it converts a "kind" name (e.g.
+// "policy", "resource") back into the plural top-level field name the
+// engine snapshot uses.
+func pluralize(kind string) string {
+	if strings.HasSuffix(kind, "y") {
+		return strings.TrimSuffix(kind, "y") + "ies"
+	}
+	return kind + "s"
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// nopResponseWriter adapts a plain io.Writer to http.ResponseWriter, just
+// enough for writeNDJSONSnapshot to stream into in tests -- it never looks
+// at headers or status codes, so those are no-ops here.
+type nopResponseWriter struct {
+	buf *bytes.Buffer
+}
+
+func (w nopResponseWriter) Header() http.Header         { return http.Header{} }
+func (w nopResponseWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w nopResponseWriter) WriteHeader(statusCode int)  {}
+
+func TestDecodeNDJSONObjectsStripsKind(t *testing.T) {
+	body := strings.NewReader(
+		`{"kind": "resource", "path": "/a"}` + "\n" +
+			`{"kind": "resource", "path": "/b"}` + "\n" +
+			`{"kind": "role", "id": "reader"}` + "\n",
+	)
+
+	objects, err := decodeNDJSONObjects(body)
+	if err != nil {
+		t.Fatalf("decodeNDJSONObjects returned error: %v", err)
+	}
+
+	if len(objects["resource"]) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(objects["resource"]))
+	}
+	if len(objects["role"]) != 1 {
+		t.Fatalf("expected 1 role, got %d", len(objects["role"]))
+	}
+
+	for kind, items := range objects {
+		for _, raw := range items {
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				t.Fatalf("could not unmarshal cleaned object: %v", err)
+			}
+			if _, hasKind := decoded["kind"]; hasKind {
+				t.Fatalf("%s object still carries a \"kind\" field after decoding: %s", kind, raw)
+			}
+		}
+	}
+}
+
+func TestDecodeNDJSONObjectsMissingKind(t *testing.T) {
+	body := strings.NewReader(`{"path": "/a"}` + "\n")
+
+	if _, err := decodeNDJSONObjects(body); err == nil {
+		t.Fatal("expected an error for an object missing \"kind\", got nil")
+	}
+}
+
+// TestNDJSONRoundTrip exercises writeNDJSONSnapshot and decodeNDJSONObjects
+// back to back, the same way a GET ?stream=1 response feeds a POST request
+// body, and checks that every object comes back grouped under the kind it
+// was written with. That the injected "kind" field is stripped back out
+// again is checked by TestDecodeNDJSONObjectsStripsKind.
+func TestNDJSONRoundTrip(t *testing.T) {
+	snapshot := map[string]interface{}{
+		"resources": []interface{}{
+			map[string]interface{}{"path": "/a"},
+			map[string]interface{}{"path": "/b"},
+		},
+		"roles": []interface{}{
+			map[string]interface{}{"id": "reader"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeNDJSONSnapshot(nopResponseWriter{&buf}, snapshot); err != nil {
+		t.Fatalf("writeNDJSONSnapshot returned error: %v", err)
+	}
+
+	objects, err := decodeNDJSONObjects(&buf)
+	if err != nil {
+		t.Fatalf("decodeNDJSONObjects returned error: %v", err)
+	}
+
+	if len(objects["resource"]) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(objects["resource"]))
+	}
+	if len(objects["role"]) != 1 {
+		t.Fatalf("expected 1 role, got %d", len(objects["role"]))
+	}
+}
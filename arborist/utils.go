@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // Return the list of JSON tags which are defined in this struct.
@@ -121,3 +123,256 @@ func unmarshal(body []byte, x interface{}) *ErrorResponse {
 	}
 	return nil
 }
+
+// shadowTypeCache memoizes the struct types built by shadowStructType, keyed
+// by the original struct type together with its optional-fields set --
+// two callers sharing a struct type but disagreeing on which fields are
+// optional must not collide on the same cached shadow.
+var shadowTypeCache sync.Map // map[shadowCacheKey]reflect.Type
+
+// shadowCacheKey is the comparable cache key for shadowTypeCache. Optional
+// field sets aren't themselves comparable (they're maps), so they're
+// canonicalized into a sorted, comma-joined string first.
+type shadowCacheKey struct {
+	structType reflect.Type
+	optional   string
+}
+
+func newShadowCacheKey(t reflect.Type, optionalFields map[string]struct{}) shadowCacheKey {
+	names := make([]string, 0, len(optionalFields))
+	for name := range optionalFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return shadowCacheKey{structType: t, optional: strings.Join(names, ",")}
+}
+
+// strictUnmarshal decodes `body` onto `x`, distinguishing an absent field
+// from one present with its zero value -- something plain `json.Unmarshal`
+// can't do, since `{}` and `{"speed":0}` decode identically onto an `int`
+// field. It does this by building a "shadow" of x's struct type where every
+// required field becomes a pointer, unmarshalling into that shadow, and
+// copying values back onto `x` while checking that every required pointer
+// got filled in. On a missing-field error `x` may already be partly filled.
+//
+// `optionalFields` names the top-level JSON field names of `x` that are
+// allowed to be absent; nested struct and slice-of-struct fields are
+// shadowed recursively, with required/optional there decided by the
+// `omitempty` tag alone, since there's no natural way to plumb a nested
+// optional-fields set through the call.
+//
+// It also checks `body`'s top-level keys against `x`'s JSON fields, the
+// same way `validateJSON` did, so a request carrying an unrecognized field
+// is rejected rather than silently ignored.
+//
+// Use this in place of the `validateJSON`+`unmarshal` pair when callers
+// need to know exactly which fields were missing, which were the wrong
+// type, and which weren't expected at all.
+func strictUnmarshal(body []byte, x interface{}, optionalFields map[string]struct{}) *ErrorResponse {
+	if optionalFields == nil {
+		optionalFields = make(map[string]struct{})
+	}
+
+	structValue := reflect.ValueOf(x)
+	if structValue.Kind() != reflect.Ptr {
+		panic("strictUnmarshal requires a pointer to a struct")
+	}
+	structValue = structValue.Elem()
+	structType := structValue.Type()
+
+	shadow := reflect.New(shadowStructType(structType, optionalFields))
+	if err := json.Unmarshal(body, shadow.Interface()); err != nil {
+		msg := fmt.Sprintf(
+			"could not parse %s from JSON; make sure input has correct types",
+			structType,
+		)
+		response := newErrorResponse(msg, 400, &err)
+		response.log.Info(
+			"tried to create %s but input was invalid; offending JSON: %s",
+			structType,
+			loggableJSON(body),
+		)
+		return response
+	}
+
+	if errResponse := checkUnexpectedTopLevelFields(body, x, structType.Name()); errResponse != nil {
+		return errResponse
+	}
+
+	missingFields := []string{}
+	copyShadowFields(shadow.Elem(), structValue, structType, optionalFields, "", &missingFields)
+	if len(missingFields) > 0 {
+		return missingRequiredFields(structType.Name(), missingFields)
+	}
+
+	return nil
+}
+
+// checkUnexpectedTopLevelFields reports any top-level key in `body` that
+// isn't a JSON field of `x`, the same check `validateJSON` used to perform
+// before strictUnmarshal replaced it. Plain `json.Unmarshal` (and the
+// shadow decode above) silently ignore unknown keys, so without this a
+// caller's typo or stale field would pass through uncaught.
+func checkUnexpectedTopLevelFields(body []byte, x interface{}, structName string) *ErrorResponse {
+	var content map[string]interface{}
+	if err := json.Unmarshal(body, &content); err != nil {
+		// body isn't a JSON object at all; the shadow decode above already
+		// would have failed for the same reason, so there's nothing new to
+		// report here.
+		return nil
+	}
+
+	expectFields := structJSONFields(x)
+	for field := range expectFields {
+		split := strings.Split(field, ",")
+		if len(split) > 1 {
+			delete(expectFields, field)
+		}
+		expectFields[split[0]] = struct{}{}
+	}
+
+	unexpectedFields := []string{}
+	for field := range content {
+		if _, exists := expectFields[field]; !exists {
+			unexpectedFields = append(unexpectedFields, field)
+		}
+	}
+	if len(unexpectedFields) > 0 {
+		return containsUnexpectedFields(structName, unexpectedFields)
+	}
+
+	return nil
+}
+
+// shadowStructType builds (and caches, per `t` and optional-fields set) a
+// struct type identical to
+// `t` except that every non-optional field which isn't already a pointer
+// becomes one, recursively through nested structs and slices of structs.
+// `encoding/json` leaves a pointer field `nil` when its key is absent,
+// which is exactly the signal `strictUnmarshal` needs.
+//
+// Struct and slice-of-struct fields are shadowed behind a pointer even when
+// they're optional, unlike optional scalar fields, which are left
+// unwrapped. Without that, an optional nested struct absent from the JSON
+// decodes to a zero-value shadow struct indistinguishable from one that was
+// present but empty, and copyShadowFields would recurse into it and flag
+// its own required fields as missing even though the whole thing was
+// legitimately never there.
+func shadowStructType(t reflect.Type, optionalFields map[string]struct{}) reflect.Type {
+	cacheKey := newShadowCacheKey(t, optionalFields)
+	if cached, ok := shadowTypeCache.Load(cacheKey); ok {
+		return cached.(reflect.Type)
+	}
+
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		_, optional := fieldJSONNameAndOptional(field, optionalFields)
+
+		fieldType := field.Type
+		recursable := false
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			fieldType = shadowStructType(fieldType, nil)
+			recursable = true
+		case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct:
+			fieldType = reflect.SliceOf(shadowStructType(fieldType.Elem(), nil))
+			recursable = true
+		}
+		if fieldType.Kind() != reflect.Ptr && (!optional || recursable) {
+			fieldType = reflect.PtrTo(fieldType)
+		}
+
+		fields = append(fields, reflect.StructField{
+			Name:      field.Name,
+			Type:      fieldType,
+			Tag:       field.Tag,
+			Anonymous: field.Anonymous,
+		})
+	}
+
+	shadow := reflect.StructOf(fields)
+	shadowTypeCache.Store(cacheKey, shadow)
+	return shadow
+}
+
+// copyShadowFields copies decoded values from a shadow struct (built by
+// shadowStructType) onto the real struct `dest`, recording the JSON name of
+// any required pointer field that came back `nil` into `missing`.
+func copyShadowFields(
+	shadow reflect.Value,
+	dest reflect.Value,
+	destType reflect.Type,
+	optionalFields map[string]struct{},
+	prefix string,
+	missing *[]string,
+) {
+	for i := 0; i < destType.NumField(); i++ {
+		field := destType.Field(i)
+		name, optional := fieldJSONNameAndOptional(field, optionalFields)
+		shadowField := shadow.Field(i)
+		destField := dest.Field(i)
+
+		// A pointer shadow field means it's required, or it's a
+		// struct/slice-of-struct field shadowed behind a pointer so absence
+		// can be told apart from a present-but-empty value (see
+		// shadowStructType), or the field on `dest` is itself a pointer.
+		// In every case a nil pointer here means the key was absent from
+		// the JSON: that's a missing-field error if the field is required,
+		// and simply skipped -- leaving dest at its zero value, with no
+		// recursion into its (nonexistent) contents -- if it's optional. A
+		// pointer-typed dest field takes the shadow's pointer as is.
+		if shadowField.Kind() == reflect.Ptr {
+			if shadowField.IsNil() {
+				if !optional {
+					*missing = append(*missing, prefix+name)
+				}
+				continue
+			}
+			if destField.Kind() != reflect.Ptr {
+				shadowField = shadowField.Elem()
+			}
+		}
+
+		switch destField.Kind() {
+		case reflect.Struct:
+			copyShadowFields(shadowField, destField, destField.Type(), nil, prefix+name+".", missing)
+		case reflect.Slice:
+			if destField.Type().Elem().Kind() == reflect.Struct {
+				length := shadowField.Len()
+				destField.Set(reflect.MakeSlice(destField.Type(), length, length))
+				for j := 0; j < length; j++ {
+					elemPrefix := fmt.Sprintf("%s%s[%d].", prefix, name, j)
+					copyShadowFields(shadowField.Index(j), destField.Index(j), destField.Index(j).Type(), nil, elemPrefix, missing)
+				}
+			} else {
+				destField.Set(shadowField)
+			}
+		default:
+			destField.Set(shadowField)
+		}
+	}
+}
+
+// fieldJSONNameAndOptional returns the JSON field name for a struct field
+// and whether it should be treated as optional: explicitly named in
+// `optionalFields`, tagged `omitempty`, or an embedded field (which has no
+// JSON name of its own to be missing).
+func fieldJSONNameAndOptional(field reflect.StructField, optionalFields map[string]struct{}) (string, bool) {
+	jsonTag := field.Tag.Get("json")
+	parts := strings.Split(jsonTag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	_, explicitlyOptional := optionalFields[name]
+	omitempty := false
+	for _, part := range parts[1:] {
+		if part == "omitempty" {
+			omitempty = true
+		}
+	}
+
+	return name, explicitlyOptional || omitempty || field.Anonymous
+}
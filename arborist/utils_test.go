@@ -0,0 +1,61 @@
+package arborist
+
+import "testing"
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type person struct {
+	Name     string  `json:"name"`
+	Age      int     `json:"age,omitempty"`
+	Home     address `json:"home,omitempty"`
+	Nickname string  `json:"nickname,omitempty"`
+}
+
+func TestStrictUnmarshalRequiredFieldPresentZeroValue(t *testing.T) {
+	var p person
+	errResponse := strictUnmarshal([]byte(`{"name": "", "home": {"street": "Main", "city": "Springfield"}}`), &p, nil)
+	if errResponse != nil {
+		t.Fatalf("expected no error for a required field present with its zero value, got %v", errResponse)
+	}
+}
+
+func TestStrictUnmarshalRequiredFieldAbsent(t *testing.T) {
+	var p person
+	errResponse := strictUnmarshal([]byte(`{"home": {"street": "Main", "city": "Springfield"}}`), &p, nil)
+	if errResponse == nil {
+		t.Fatal("expected an error for a missing required field, got nil")
+	}
+}
+
+func TestStrictUnmarshalOptionalNestedStructAbsent(t *testing.T) {
+	var p person
+	errResponse := strictUnmarshal([]byte(`{"name": "Alice"}`), &p, nil)
+	if errResponse != nil {
+		t.Fatalf("expected no error when an optional nested struct is entirely absent, got %v", errResponse)
+	}
+	if p.Home != (address{}) {
+		t.Fatalf("expected Home to stay zero-valued, got %+v", p.Home)
+	}
+}
+
+func TestStrictUnmarshalOptionalNestedStructPresent(t *testing.T) {
+	var p person
+	errResponse := strictUnmarshal([]byte(`{"name": "Alice", "home": {"street": "Main", "city": "Springfield"}}`), &p, nil)
+	if errResponse != nil {
+		t.Fatalf("expected no error, got %v", errResponse)
+	}
+	if p.Home.Street != "Main" || p.Home.City != "Springfield" {
+		t.Fatalf("expected Home to be populated, got %+v", p.Home)
+	}
+}
+
+func TestStrictUnmarshalUnexpectedField(t *testing.T) {
+	var p person
+	errResponse := strictUnmarshal([]byte(`{"name": "Alice", "extra": "field"}`), &p, nil)
+	if errResponse == nil {
+		t.Fatal("expected an error for an unexpected top-level field, got nil")
+	}
+}